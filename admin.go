@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"resty.dev/v3"
+)
+
+// adminServer proxies operator-triggered restarts to the Kafka Connect REST
+// API of one of the configured clusters, so alertmanager webhooks can
+// restart failed connectors/tasks without needing direct network access to
+// Connect.
+type adminServer struct {
+	clients map[string]*resty.Client
+}
+
+func newAdminServer(collectors []*restAPICollector) *adminServer {
+	clients := make(map[string]*resty.Client, len(collectors))
+	for _, collector := range collectors {
+		clients[collector.clusterName] = collector.api
+	}
+	return &adminServer{clients: clients}
+}
+
+// resolve returns the REST client for the named cluster, or the sole
+// configured cluster's client if name is empty and there is only one.
+func (a *adminServer) resolve(name string) (*resty.Client, error) {
+	if name != "" {
+		client, ok := a.clients[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cluster %q", name)
+		}
+		return client, nil
+	}
+	if len(a.clients) == 1 {
+		for _, client := range a.clients {
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("cluster query parameter is required when more than one cluster is configured")
+}
+
+// restartHandler implements POST /connectors/{name}/restart, proxying to
+// the Connect REST API's own restart endpoint.
+func (a *adminServer) restartHandler(w http.ResponseWriter, r *http.Request) {
+	connector := mux.Vars(r)["name"]
+
+	client, err := a.resolve(r.URL.Query().Get("cluster"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := client.R()
+	if v := r.URL.Query().Get("includeTasks"); v != "" {
+		req.SetQueryParam("includeTasks", v)
+	}
+	if v := r.URL.Query().Get("onlyFailed"); v != "" {
+		req.SetQueryParam("onlyFailed", v)
+	}
+
+	response, err := req.Post(fmt.Sprintf("/connectors/%s/restart", connector))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error proxying restart to Kafka Connect: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(response.StatusCode())
+	w.Write(response.Bytes())
+}
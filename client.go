@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"resty.dev/v3"
+)
+
+// newConnectClient builds the resty client used to talk to a cluster's
+// Connect REST API, wiring up TLS, auth and retry/backoff from cluster's
+// config. It performs no network I/O itself.
+func newConnectClient(cluster ClusterConfig) (*resty.Client, error) {
+	api := resty.New().SetBaseURL(cluster.APIURL)
+
+	if cluster.TLS != nil {
+		tlsConfig, err := buildTLSConfig(cluster.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring TLS for cluster %s: %v", cluster.Name, err)
+		}
+		api.SetTLSClientConfig(tlsConfig)
+	}
+
+	if cluster.Auth != nil {
+		if cluster.Auth.BasicAuth != nil {
+			api.SetBasicAuth(cluster.Auth.BasicAuth.Username, cluster.Auth.BasicAuth.Password)
+		} else if cluster.Auth.BearerTokenFile != "" {
+			tokenFile := cluster.Auth.BearerTokenFile
+			api.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+				token, err := os.ReadFile(tokenFile)
+				if err != nil {
+					return fmt.Errorf("error reading bearer token file %s: %v", tokenFile, err)
+				}
+				req.SetAuthToken(strings.TrimSpace(string(token)))
+				return nil
+			})
+		} else if cluster.Auth.BearerToken != "" {
+			api.SetAuthToken(cluster.Auth.BearerToken)
+		}
+	}
+
+	retry := cluster.Retry
+	if retry == nil {
+		retry = &RetryConfig{MaxAttempts: defaultRetryMaxAttempts, MinWait: defaultRetryMinWait, MaxWait: defaultRetryMaxWait}
+	}
+	api.SetRetryCount(retry.MaxAttempts - 1).
+		SetRetryWaitTime(retry.MinWait.AsDuration()).
+		SetRetryMaxWaitTime(retry.MaxWait.AsDuration()).
+		AddRetryCondition(func(response *resty.Response, err error) bool {
+			return err != nil || response.StatusCode() >= 500
+		})
+
+	return api, nil
+}
+
+// buildTLSConfig translates a TLSConfig into a crypto/tls.Config suitable
+// for resty's SetTLSClientConfig.
+func buildTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		caCert, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
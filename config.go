@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration wraps time.Duration so config fields can be written as
+// human-readable strings ("10s", "500ms") in YAML. yaml.v3 has no built-in
+// support for time.Duration, which only decodes from a bare integer of
+// nanoseconds otherwise.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// AsDuration returns d as a time.Duration for use with the standard
+// library and third-party clients.
+func (d Duration) AsDuration() time.Duration {
+	return time.Duration(d)
+}
+
+// Config is the top-level exporter configuration, loaded from a YAML file
+// passed via the -config flag. It declares the set of Kafka Connect
+// clusters to scrape, modeled after ccloudexporter's rules.clusters.
+type Config struct {
+	Clusters []ClusterConfig `yaml:"clusters"`
+	// Modules names reusable auth configurations that /probe requests can
+	// select via the module query parameter, mirroring blackbox_exporter.
+	Modules map[string]ModuleConfig `yaml:"modules"`
+}
+
+// ModuleConfig is a reusable, named auth configuration for the /probe
+// endpoint, so Prometheus can point at arbitrary Connect clusters without
+// a static cluster entry per target.
+type ModuleConfig struct {
+	BasicAuth *BasicAuthConfig `yaml:"basic_auth"`
+	// BearerToken authenticates with the Connect REST API using a static
+	// bearer token.
+	BearerToken string `yaml:"bearer_token"`
+}
+
+// BasicAuthConfig holds HTTP basic auth credentials for a module or a
+// cluster.
+type BasicAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// ClusterConfig describes a single Kafka Connect cluster to scrape.
+type ClusterConfig struct {
+	// Name is a short, friendly identifier for the cluster, exposed on
+	// every series as the connect_cluster label. Defaults to APIURL if
+	// empty.
+	Name string `yaml:"name"`
+	// Environment is an optional free-form label (e.g. "staging",
+	// "production") applied to every series emitted for this cluster.
+	Environment string `yaml:"environment"`
+	// APIURL is the base URL of the Kafka Connect REST API.
+	APIURL string `yaml:"api_url"`
+	// Include, if set, restricts scraping to connectors whose name
+	// matches this regular expression.
+	Include string `yaml:"include"`
+	// Exclude, if set, skips connectors whose name matches this regular
+	// expression. Exclude is applied after Include.
+	Exclude string `yaml:"exclude"`
+	// ScrapeInterval controls how often cached, cluster-wide data (such
+	// as broker end offsets) is refreshed. It does not gate the
+	// per-request Prometheus scrape itself.
+	ScrapeInterval Duration `yaml:"scrape_interval"`
+	// ScrapeTimeout is the timeout for a single collection of this
+	// cluster. LoadConfig fills in a default, but the collector does not
+	// apply it: requests to the Connect REST API are not aborted after
+	// ScrapeTimeout, and only a /probe request's own deadline bounds them.
+	ScrapeTimeout Duration `yaml:"scrape_timeout"`
+	// Kafka, if set, points at the Kafka cluster backing this Connect
+	// cluster, and enables consumer lag and log end offset metrics.
+	Kafka *KafkaConfig `yaml:"kafka"`
+	// Auth configures how the exporter authenticates to this cluster's
+	// Connect REST API.
+	Auth *AuthConfig `yaml:"auth"`
+	// TLS configures the client's transport when talking to the Connect
+	// REST API, for mTLS or a custom CA bundle.
+	TLS *TLSConfig `yaml:"tls"`
+	// Retry configures retry/backoff for requests to the Connect REST
+	// API. Defaults apply when nil.
+	Retry *RetryConfig `yaml:"retry"`
+}
+
+// AuthConfig configures how the exporter authenticates to a Connect REST
+// API. At most one of BasicAuth or BearerToken/BearerTokenFile should be
+// set.
+type AuthConfig struct {
+	BasicAuth *BasicAuthConfig `yaml:"basic_auth"`
+	// BearerToken is a static bearer token.
+	BearerToken string `yaml:"bearer_token"`
+	// BearerTokenFile, if set, is re-read on every request so a token
+	// rotated on disk (e.g. by a Kubernetes projected volume) takes
+	// effect without restarting the exporter.
+	BearerTokenFile string `yaml:"bearer_token_file"`
+}
+
+// TLSConfig configures the HTTP client's transport for a Connect REST API.
+type TLSConfig struct {
+	// CertFile and KeyFile, if both set, enable mTLS with the Connect
+	// REST API.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CAFile, if set, is used instead of the system CA bundle to verify
+	// the server's certificate.
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// RetryConfig configures retry/backoff for requests to a Connect REST API.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	MaxAttempts int `yaml:"max_attempts"`
+	// MinWait and MaxWait bound the exponential backoff with jitter
+	// between attempts.
+	MinWait Duration `yaml:"min_wait"`
+	MaxWait Duration `yaml:"max_wait"`
+}
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinWait     = Duration(500 * time.Millisecond)
+	defaultRetryMaxWait     = Duration(5 * time.Second)
+)
+
+// KafkaConfig describes how to reach the Kafka brokers backing a Connect
+// cluster, so that committed offsets can be compared against broker end
+// offsets to derive consumer lag.
+type KafkaConfig struct {
+	// Brokers is the list of bootstrap broker addresses.
+	Brokers []string `yaml:"brokers"`
+	// SASL, if set, enables SASL authentication against the brokers.
+	SASL *SASLConfig `yaml:"sasl"`
+	// EndOffsetCacheTTL controls how long a topic partition's broker end
+	// offset is cached before ListOffsets is called again. Defaults to
+	// ScrapeInterval when zero.
+	EndOffsetCacheTTL Duration `yaml:"end_offset_cache_ttl"`
+	// TLS configures the Kafka client's transport, for SASL_SSL/SSL
+	// listeners or mTLS against the brokers.
+	TLS *TLSConfig `yaml:"tls"`
+	// SourceClusterAlias, if set, is the cluster identity that source
+	// connectors on this Connect cluster use to label their own Kafka in
+	// offsets (e.g. MirrorMaker's source.cluster.alias). Source-side lag
+	// is only computed when a connector's offsets report this same
+	// cluster, since otherwise the committed offsets belong to a
+	// different Kafka than the one configured here.
+	SourceClusterAlias string `yaml:"source_cluster_alias"`
+}
+
+// SASLConfig holds SASL credentials for connecting to Kafka brokers.
+type SASLConfig struct {
+	// Mechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512.
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+const (
+	defaultScrapeInterval = Duration(30 * time.Second)
+	defaultScrapeTimeout  = Duration(10 * time.Second)
+)
+
+// LoadConfig reads and validates the exporter configuration from path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %v", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+
+	if len(cfg.Clusters) == 0 {
+		return nil, fmt.Errorf("config file %s declares no clusters", path)
+	}
+
+	for i := range cfg.Clusters {
+		cluster := &cfg.Clusters[i]
+		if cluster.APIURL == "" {
+			return nil, fmt.Errorf("cluster %d is missing api_url", i)
+		}
+		if cluster.Name == "" {
+			cluster.Name = cluster.APIURL
+		}
+		if cluster.ScrapeInterval == 0 {
+			cluster.ScrapeInterval = defaultScrapeInterval
+		}
+		if cluster.ScrapeTimeout == 0 {
+			cluster.ScrapeTimeout = defaultScrapeTimeout
+		}
+		if cluster.Kafka != nil {
+			if len(cluster.Kafka.Brokers) == 0 {
+				return nil, fmt.Errorf("cluster %s has a kafka section but no brokers", cluster.Name)
+			}
+			if cluster.Kafka.EndOffsetCacheTTL == 0 {
+				cluster.Kafka.EndOffsetCacheTTL = cluster.ScrapeInterval
+			}
+			if cluster.Kafka.SASL != nil {
+				switch cluster.Kafka.SASL.Mechanism {
+				case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+				default:
+					return nil, fmt.Errorf("cluster %s has unsupported SASL mechanism %q", cluster.Name, cluster.Kafka.SASL.Mechanism)
+				}
+			}
+			if cluster.Kafka.TLS != nil && (cluster.Kafka.TLS.CertFile == "") != (cluster.Kafka.TLS.KeyFile == "") {
+				return nil, fmt.Errorf("cluster %s kafka section must set both cert_file and key_file, or neither", cluster.Name)
+			}
+		}
+		if cluster.Include != "" {
+			if _, err := regexp.Compile(cluster.Include); err != nil {
+				return nil, fmt.Errorf("cluster %s has invalid include regex: %v", cluster.Name, err)
+			}
+		}
+		if cluster.Exclude != "" {
+			if _, err := regexp.Compile(cluster.Exclude); err != nil {
+				return nil, fmt.Errorf("cluster %s has invalid exclude regex: %v", cluster.Name, err)
+			}
+		}
+		if cluster.TLS != nil && (cluster.TLS.CertFile == "") != (cluster.TLS.KeyFile == "") {
+			return nil, fmt.Errorf("cluster %s must set both cert_file and key_file, or neither", cluster.Name)
+		}
+		if cluster.Retry == nil {
+			cluster.Retry = &RetryConfig{}
+		}
+		if cluster.Retry.MaxAttempts == 0 {
+			cluster.Retry.MaxAttempts = defaultRetryMaxAttempts
+		}
+		if cluster.Retry.MinWait == 0 {
+			cluster.Retry.MinWait = defaultRetryMinWait
+		}
+		if cluster.Retry.MaxWait == 0 {
+			cluster.Retry.MaxWait = defaultRetryMaxWait
+		}
+	}
+
+	return &cfg, nil
+}
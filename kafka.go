@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// dialRetryCooldown bounds how often a broken Kafka client retries dialing
+// the brokers, so a persistently unreachable cluster doesn't turn every
+// scrape into a fresh connection attempt.
+const dialRetryCooldown = 30 * time.Second
+
+// topicPartition identifies a single Kafka topic partition.
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// endOffsetCache resolves the current log end offset ("high water mark")
+// for a topic partition, refreshing from the brokers at most once per
+// ttl so that a busy /metrics endpoint doesn't hammer ListOffsets.
+//
+// The underlying sarama client is dialed lazily and re-dialed on demand:
+// brokers that are unreachable at exporter startup (e.g. during a rolling
+// restart) must not prevent the exporter itself from starting, so failures
+// here are reported through EndOffset rather than at construction time.
+type endOffsetCache struct {
+	cfg *KafkaConfig
+	ttl time.Duration
+
+	mu              sync.Mutex
+	client          sarama.Client
+	lastDialAttempt time.Time
+	offsets         map[topicPartition]cachedOffset
+}
+
+type cachedOffset struct {
+	offset    int64
+	fetchedAt time.Time
+}
+
+// newEndOffsetCache returns a cache for the Kafka cluster described by cfg.
+// It attempts an initial dial but does not fail if the brokers are
+// unreachable; EndOffset transparently retries.
+func newEndOffsetCache(cfg *KafkaConfig) *endOffsetCache {
+	c := &endOffsetCache{
+		cfg:     cfg,
+		ttl:     cfg.EndOffsetCacheTTL.AsDuration(),
+		offsets: make(map[topicPartition]cachedOffset),
+	}
+	if err := c.dial(); err != nil {
+		log.Printf("Warning: error connecting to Kafka brokers %v: %v (will retry)", cfg.Brokers, err)
+	}
+	return c
+}
+
+// dial connects to the brokers if not already connected, rate-limited by
+// dialRetryCooldown so a persistently down cluster doesn't get hammered.
+func (c *endOffsetCache) dial() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		return nil
+	}
+	if !c.lastDialAttempt.IsZero() && time.Since(c.lastDialAttempt) < dialRetryCooldown {
+		return fmt.Errorf("recently failed to connect to Kafka brokers %v, still cooling down", c.cfg.Brokers)
+	}
+	c.lastDialAttempt = time.Now()
+
+	saramaConfig, err := saramaClientConfig(c.cfg)
+	if err != nil {
+		return fmt.Errorf("error configuring Kafka client: %v", err)
+	}
+
+	client, err := sarama.NewClient(c.cfg.Brokers, saramaConfig)
+	if err != nil {
+		return fmt.Errorf("error connecting to Kafka brokers %v: %v", c.cfg.Brokers, err)
+	}
+	c.client = client
+	return nil
+}
+
+// saramaClientConfig translates a KafkaConfig into the sarama.Config used
+// to dial the brokers.
+func saramaClientConfig(cfg *KafkaConfig) (*sarama.Config, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Version = sarama.DefaultVersion
+
+	if cfg.SASL != nil {
+		saramaConfig.Net.SASL.Enable = true
+		saramaConfig.Net.SASL.User = cfg.SASL.Username
+		saramaConfig.Net.SASL.Password = cfg.SASL.Password
+		switch cfg.SASL.Mechanism {
+		case "SCRAM-SHA-256":
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = scramClientGeneratorFunc(cfg.SASL.Mechanism)
+		case "SCRAM-SHA-512":
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = scramClientGeneratorFunc(cfg.SASL.Mechanism)
+		default:
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		}
+	}
+
+	if cfg.TLS != nil {
+		tlsConfig, err := buildTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring Kafka TLS: %v", err)
+		}
+		saramaConfig.Net.TLS.Enable = true
+		saramaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	return saramaConfig, nil
+}
+
+// EndOffset returns the log end offset of topic/partition, using a cached
+// value if it was fetched less than ttl ago.
+func (c *endOffsetCache) EndOffset(topic string, partition int32) (int64, error) {
+	key := topicPartition{topic: topic, partition: partition}
+
+	c.mu.Lock()
+	cached, ok := c.offsets[key]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.offset, nil
+	}
+
+	if err := c.dial(); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+
+	offset, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		// The client may be stale (e.g. the brokers were bounced); drop it
+		// so the next call re-dials instead of repeating the same error
+		// forever.
+		c.mu.Lock()
+		c.client = nil
+		c.mu.Unlock()
+		return 0, fmt.Errorf("error fetching end offset for %s/%d: %v", topic, partition, err)
+	}
+
+	c.mu.Lock()
+	c.offsets[key] = cachedOffset{offset: offset, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return offset, nil
+}
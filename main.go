@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -16,9 +21,25 @@ import (
 
 type collectorsResponse []string
 
+// connectorStates enumerates every state Kafka Connect can report for a
+// connector or task, used to emit the full 0/1 gauge set for each scrape.
+var connectorStates = []string{"running", "paused", "failed", "unassigned", "restarting"}
+
+type taskStatus struct {
+	ID       int    `json:"id"`
+	State    string `json:"state"`
+	WorkerID string `json:"worker_id"`
+	Trace    string `json:"trace"`
+}
+
 type collectorStatusResponse struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
+	Name      string `json:"name"`
+	Connector struct {
+		State    string `json:"state"`
+		WorkerID string `json:"worker_id"`
+	} `json:"connector"`
+	Tasks []taskStatus `json:"tasks"`
+	Type  string       `json:"type"`
 }
 
 type sourcePartition struct {
@@ -55,94 +76,376 @@ type sinkCollectorOffsetsResponse struct {
 }
 
 type restAPICollector struct {
-	offset *prometheus.Desc
-
-	api *resty.Client
+	offset         *prometheus.Desc
+	lag            *prometheus.Desc
+	logEndOffset   *prometheus.Desc
+	connectorState *prometheus.Desc
+	taskState      *prometheus.Desc
+	taskInfo       *prometheus.Desc
+	scrapeDuration *prometheus.Desc
+	scrapeSuccess  *prometheus.Desc
+	up             *prometheus.Desc
+
+	api   *resty.Client
+	kafka *endOffsetCache
+	ctx   context.Context
+
+	clusterName string
+	environment string
+	include     *regexp.Regexp
+	exclude     *regexp.Regexp
+
+	// sourceClusterAlias, if set, is the Kafka cluster identity that a
+	// source connector's offsets must report for collectSourceOffsets to
+	// compute lag against collector.kafka.
+	sourceClusterAlias string
 }
 
-func newRestAPICollector(api_url string) (prometheus.Collector, error) {
-
-	api := resty.New().SetBaseURL(api_url)
+func newRestAPICollector(ctx context.Context, cluster ClusterConfig) (*restAPICollector, error) {
+	api, err := newConnectClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return newRestAPICollectorFromClient(ctx, cluster, api)
+}
 
-	// Test the API connection
-	response, err := api.R().Get("/connectors")
+// newRestAPICollectorFromClient builds a restAPICollector around an
+// already-constructed REST client, so callers that scrape the same target
+// repeatedly (e.g. the /probe handler) can reuse one client's connection
+// pool across collectors instead of dialing a fresh one per request.
+func newRestAPICollectorFromClient(ctx context.Context, cluster ClusterConfig, api *resty.Client) (*restAPICollector, error) {
+	// Probe the API connection, but don't fail collector creation on
+	// error: a Connect cluster that is briefly unreachable at exporter
+	// startup (e.g. during a coordinated rolling restart) shouldn't
+	// crash-loop the exporter. kafka_connect_up reports the real-time
+	// state on every scrape instead.
+	response, err := api.R().SetContext(ctx).Get("/connectors")
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to Kafka Connect API at %s: %v", api_url, err)
+		log.Printf("Warning: error connecting to Kafka Connect API at %s: %v", cluster.APIURL, err)
+	} else if response.StatusCode() != http.StatusOK {
+		log.Printf("Warning: unexpected status code from Kafka Connect API at %s: %d", cluster.APIURL, response.StatusCode())
 	}
-	if response.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code from Kafka Connect API at %s: %d", api_url, response.StatusCode())
+
+	var include, exclude *regexp.Regexp
+	if cluster.Include != "" {
+		include = regexp.MustCompile(cluster.Include)
+	}
+	if cluster.Exclude != "" {
+		exclude = regexp.MustCompile(cluster.Exclude)
+	}
+
+	var kafka *endOffsetCache
+	var sourceClusterAlias string
+	if cluster.Kafka != nil {
+		// Unreachable brokers at startup must not crash-loop the
+		// exporter either; newEndOffsetCache retries lazily.
+		kafka = newEndOffsetCache(cluster.Kafka)
+		sourceClusterAlias = cluster.Kafka.SourceClusterAlias
 	}
 
 	return &restAPICollector{
 		offset: prometheus.NewDesc("kafka_connect_current_offset",
 			"The current offset of the Kafka Connect connector",
-			[]string{"connector", "cluster", "topic", "partition"}, nil,
+			[]string{"connector", "connect_cluster", "environment", "cluster", "topic", "partition"}, nil,
+		),
+		lag: prometheus.NewDesc("kafka_connect_consumer_lag",
+			"The difference between the Kafka broker's end offset and the connector's committed offset",
+			[]string{"connector", "connect_cluster", "environment", "topic", "partition"}, nil,
+		),
+		logEndOffset: prometheus.NewDesc("kafka_connect_log_end_offset",
+			"The current end offset of a Kafka topic partition, as reported by the broker",
+			[]string{"connect_cluster", "environment", "topic", "partition"}, nil,
+		),
+		connectorState: prometheus.NewDesc("kafka_connect_connector_state",
+			"Whether the connector currently is in the given state (1) or not (0)",
+			[]string{"connector", "connect_cluster", "environment", "state"}, nil,
+		),
+		taskState: prometheus.NewDesc("kafka_connect_task_state",
+			"Whether the connector's task currently is in the given state (1) or not (0)",
+			[]string{"connector", "task", "worker", "connect_cluster", "environment", "state"}, nil,
 		),
-		api: api,
+		taskInfo: prometheus.NewDesc("kafka_connect_task_info",
+			"Labels-only metric carrying the worker a connector's task is currently assigned to",
+			[]string{"connector", "task", "worker", "connect_cluster", "environment"}, nil,
+		),
+		scrapeDuration: prometheus.NewDesc("kafka_connect_scrape_duration_seconds",
+			"How long it took to fetch a given Kafka Connect REST API endpoint for a connector",
+			[]string{"connector", "connect_cluster", "environment", "endpoint"}, nil,
+		),
+		scrapeSuccess: prometheus.NewDesc("kafka_connect_scrape_success",
+			"Whether all REST API calls needed to scrape a connector succeeded",
+			[]string{"connector", "connect_cluster", "environment"}, nil,
+		),
+		up: prometheus.NewDesc("kafka_connect_up",
+			"Whether the Kafka Connect cluster's REST API responded to the /connectors call",
+			[]string{"connect_cluster", "environment"}, nil,
+		),
+		api:                api,
+		kafka:              kafka,
+		ctx:                ctx,
+		clusterName:        cluster.Name,
+		environment:        cluster.Environment,
+		include:            include,
+		exclude:            exclude,
+		sourceClusterAlias: sourceClusterAlias,
 	}, nil
 }
 
+// scrape reports whether connector should be scraped, applying the
+// cluster's include/exclude regexes in that order.
+func (collector *restAPICollector) scrape(connector string) bool {
+	if collector.include != nil && !collector.include.MatchString(connector) {
+		return false
+	}
+	if collector.exclude != nil && collector.exclude.MatchString(connector) {
+		return false
+	}
+	return true
+}
+
 // Each and every collector must implement the Describe function.
 // It essentially writes all descriptors to the prometheus desc channel.
 func (collector *restAPICollector) Describe(ch chan<- *prometheus.Desc) {
 
 	//Update this section with the each metric you create for a given collector
 	ch <- collector.offset
+	ch <- collector.lag
+	ch <- collector.logEndOffset
+	ch <- collector.connectorState
+	ch <- collector.taskState
+	ch <- collector.taskInfo
+	ch <- collector.scrapeDuration
+	ch <- collector.scrapeSuccess
+	ch <- collector.up
 }
 
 // Collect implements required collect function for all promehteus collectors
 func (collector *restAPICollector) Collect(ch chan<- prometheus.Metric) {
 
-	response, err := collector.api.R().SetResult(&collectorsResponse{}).Get("/connectors")
-	if err != nil {
+	response, err := collector.api.R().SetContext(collector.ctx).SetResult(&collectorsResponse{}).Get("/connectors")
+	up := err == nil && response.IsSuccess()
+	ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, boolToFloat(up), collector.clusterName, collector.environment)
+	if !up {
 		log.Printf("Error fetching connectors: %v", err)
 		return
 	}
+
+	// seenLogEndOffsets dedupes kafka_connect_log_end_offset across
+	// connectors that happen to share a topic, since it is a per-topic
+	// series rather than a per-connector one.
+	seenLogEndOffsets := make(map[topicPartition]bool)
+
 	for _, connector := range *response.Result().(*collectorsResponse) {
 
-		response, err := collector.api.R().SetResult(&collectorStatusResponse{}).Get(fmt.Sprintf("/connectors/%s/status", connector))
-		if err != nil {
+		if !collector.scrape(connector) {
+			continue
+		}
+
+		response, err := collector.scrapeEndpoint(ch, connector, "status", fmt.Sprintf("/connectors/%s/status", connector), &collectorStatusResponse{})
+		success := err == nil && response.IsSuccess()
+		if !success {
 			log.Printf("Error fetching status for connector %s: %v", connector, err)
+			collector.emitScrapeSuccess(ch, connector, false)
 			continue
 		}
 		connectorStatus := response.Result().(*collectorStatusResponse)
 
-		if connectorStatus.Type == "source" {
-			collector.collectSourceOffsets(ch, connector)
-		} else if connectorStatus.Type == "sink" {
-			collector.collectSinkOffsets(ch, connector)
-		} else {
+		collector.collectConnectorState(ch, connector, connectorStatus)
+
+		switch connectorStatus.Type {
+		case "source":
+			success = collector.collectSourceOffsets(ch, connector, seenLogEndOffsets)
+		case "sink":
+			success = collector.collectSinkOffsets(ch, connector, seenLogEndOffsets)
+		default:
 			log.Printf("Unknown connector type for connector %s: %s", connector, connectorStatus.Type)
+			success = false
+		}
+
+		collector.emitScrapeSuccess(ch, connector, success)
+	}
+}
+
+// scrapeEndpoint performs a timed GET against the Connect REST API,
+// recording kafka_connect_scrape_duration_seconds for the given logical
+// endpoint name regardless of outcome.
+func (collector *restAPICollector) scrapeEndpoint(ch chan<- prometheus.Metric, connector, endpoint, path string, result interface{}) (*resty.Response, error) {
+	start := time.Now()
+	response, err := collector.api.R().SetContext(collector.ctx).SetResult(result).Get(path)
+	duration := time.Since(start).Seconds()
+
+	ch <- prometheus.MustNewConstMetric(
+		collector.scrapeDuration,
+		prometheus.GaugeValue,
+		duration,
+		connector,
+		collector.clusterName,
+		collector.environment,
+		endpoint,
+	)
+
+	return response, err
+}
+
+func (collector *restAPICollector) emitScrapeSuccess(ch chan<- prometheus.Metric, connector string, success bool) {
+	ch <- prometheus.MustNewConstMetric(
+		collector.scrapeSuccess,
+		prometheus.GaugeValue,
+		boolToFloat(success),
+		connector,
+		collector.clusterName,
+		collector.environment,
+	)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// collectConnectorState emits the connector's own kafka_connect_connector_state
+// gauges plus kafka_connect_task_state and kafka_connect_task_info for each
+// of its tasks.
+func (collector *restAPICollector) collectConnectorState(ch chan<- prometheus.Metric, connector string, status *collectorStatusResponse) {
+	current := strings.ToLower(status.Connector.State)
+	for _, state := range connectorStates {
+		value := 0.0
+		if state == current {
+			value = 1
 		}
+		ch <- prometheus.MustNewConstMetric(
+			collector.connectorState,
+			prometheus.GaugeValue,
+			value,
+			connector,
+			collector.clusterName,
+			collector.environment,
+			state,
+		)
+	}
+
+	for _, task := range status.Tasks {
+		taskID := fmt.Sprintf("%d", task.ID)
+		taskCurrent := strings.ToLower(task.State)
+
+		for _, state := range connectorStates {
+			value := 0.0
+			if state == taskCurrent {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				collector.taskState,
+				prometheus.GaugeValue,
+				value,
+				connector,
+				taskID,
+				task.WorkerID,
+				collector.clusterName,
+				collector.environment,
+				state,
+			)
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			collector.taskInfo,
+			prometheus.GaugeValue,
+			1,
+			connector,
+			taskID,
+			task.WorkerID,
+			collector.clusterName,
+			collector.environment,
+		)
 	}
 }
 
-func (collector *restAPICollector) collectSourceOffsets(ch chan<- prometheus.Metric, connector string) {
-	response, err := collector.api.R().SetResult(&sourceCollectorOffsetsResponse{}).Get(fmt.Sprintf("/connectors/%s/offsets", connector))
+// collectLag emits kafka_connect_consumer_lag for connector/topic/partition,
+// and kafka_connect_log_end_offset for topic/partition the first time it is
+// seen in this Collect call, provided the cluster has a Kafka client
+// configured.
+func (collector *restAPICollector) collectLag(ch chan<- prometheus.Metric, connector, topic string, partition int, committedOffset int, seenLogEndOffsets map[topicPartition]bool) {
+	if collector.kafka == nil {
+		return
+	}
 
+	end, err := collector.kafka.EndOffset(topic, int32(partition))
 	if err != nil {
-		log.Printf("Error fetching offsets for connector %s: %v", connector, err)
+		log.Printf("Error fetching end offset for %s/%d: %v", topic, partition, err)
+		return
+	}
+
+	partitionLabel := fmt.Sprintf("%d", partition)
+
+	ch <- prometheus.MustNewConstMetric(
+		collector.lag,
+		prometheus.GaugeValue,
+		float64(end-int64(committedOffset)),
+		connector,
+		collector.clusterName,
+		collector.environment,
+		topic,
+		partitionLabel,
+	)
+
+	key := topicPartition{topic: topic, partition: int32(partition)}
+	if seenLogEndOffsets[key] {
 		return
 	}
+	seenLogEndOffsets[key] = true
+
+	ch <- prometheus.MustNewConstMetric(
+		collector.logEndOffset,
+		prometheus.GaugeValue,
+		float64(end),
+		collector.clusterName,
+		collector.environment,
+		topic,
+		partitionLabel,
+	)
+}
+
+func (collector *restAPICollector) collectSourceOffsets(ch chan<- prometheus.Metric, connector string, seenLogEndOffsets map[topicPartition]bool) bool {
+	response, err := collector.scrapeEndpoint(ch, connector, "offsets", fmt.Sprintf("/connectors/%s/offsets", connector), &sourceCollectorOffsetsResponse{})
+
+	if err != nil || !response.IsSuccess() {
+		log.Printf("Error fetching offsets for connector %s: %v", connector, err)
+		return false
+	}
 	for _, offset := range response.Result().(*sourceCollectorOffsetsResponse).Offsets {
 		ch <- prometheus.MustNewConstMetric(
 			collector.offset,
 			prometheus.GaugeValue,
 			float64(offset.Offset.Offset),
 			connector,
+			collector.clusterName,
+			collector.environment,
 			offset.Partition.Cluster,
 			offset.Partition.Topic,
 			fmt.Sprintf("%d", offset.Partition.Partition),
 		)
+		// offset.Partition.Cluster is only populated when the source
+		// system is itself a Kafka cluster (e.g. MirrorMaker), and it may
+		// not be the same Kafka as collector.kafka: MirrorMaker connectors
+		// commonly replicate from a cluster other than the one backing
+		// this Connect cluster. Only compute lag when the connector's
+		// offsets report the cluster configured as source_cluster_alias,
+		// so we don't query collector.kafka for topics that live on a
+		// different Kafka entirely.
+		if collector.sourceClusterAlias != "" && offset.Partition.Cluster == collector.sourceClusterAlias {
+			collector.collectLag(ch, connector, offset.Partition.Topic, offset.Partition.Partition, offset.Offset.Offset, seenLogEndOffsets)
+		}
 	}
+	return true
 }
 
-func (collector *restAPICollector) collectSinkOffsets(ch chan<- prometheus.Metric, connector string) {
-	response, err := collector.api.R().SetResult(&sinkCollectorOffsetsResponse{}).Get(fmt.Sprintf("/connectors/%s/offsets", connector))
+func (collector *restAPICollector) collectSinkOffsets(ch chan<- prometheus.Metric, connector string, seenLogEndOffsets map[topicPartition]bool) bool {
+	response, err := collector.scrapeEndpoint(ch, connector, "offsets", fmt.Sprintf("/connectors/%s/offsets", connector), &sinkCollectorOffsetsResponse{})
 
-	if err != nil {
+	if err != nil || !response.IsSuccess() {
 		log.Printf("Error fetching offsets for connector %s: %v", connector, err)
-		return
+		return false
 	}
 	for _, offset := range response.Result().(*sinkCollectorOffsetsResponse).Offsets {
 		ch <- prometheus.MustNewConstMetric(
@@ -150,36 +453,56 @@ func (collector *restAPICollector) collectSinkOffsets(ch chan<- prometheus.Metri
 			prometheus.GaugeValue,
 			float64(offset.Offset.Offset),
 			connector,
+			collector.clusterName,
+			collector.environment,
 			"",
 			offset.Partition.Topic,
 			fmt.Sprintf("%d", offset.Partition.Partition),
 		)
+		collector.collectLag(ch, connector, offset.Partition.Topic, offset.Partition.Partition, offset.Offset.Offset, seenLogEndOffsets)
 	}
+	return true
 }
 
 func main() {
-	connectAPI, port, err := parseArgs(os.Args[1:])
+	configPath, port, err := parseArgs(os.Args[1:])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
 
-	collector, err := newRestAPICollector(connectAPI)
+	config, err := LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Error creating REST API collector: %v", err)
+		log.Fatalf("Error loading config: %v", err)
 	}
 
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(
 		collectors.NewGoCollector(),
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
-		collector,
 	)
 
-	http.Handle("/metrics", handlers.LoggingHandler(os.Stdout, promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
-	log.Printf("Connect API at %v", connectAPI)
+	restCollectors := make([]*restAPICollector, 0, len(config.Clusters))
+	for _, cluster := range config.Clusters {
+		collector, err := newRestAPICollector(context.Background(), cluster)
+		if err != nil {
+			log.Fatalf("Error creating REST API collector for cluster %s: %v", cluster.Name, err)
+		}
+		reg.MustRegister(collector)
+		restCollectors = append(restCollectors, collector)
+		log.Printf("Registered cluster %s at %s", cluster.Name, cluster.APIURL)
+	}
+
+	admin := newAdminServer(restCollectors)
+	probe := newProbeServer(config)
+
+	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	router.HandleFunc("/probe", probe.handler)
+	router.HandleFunc("/connectors/{name}/restart", admin.restartHandler).Methods(http.MethodPost)
+
 	log.Printf("Starting server on port %d", port)
-	http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	http.ListenAndServe(fmt.Sprintf(":%d", port), handlers.LoggingHandler(os.Stdout, router))
 }
 
 func parseArgs(args []string) (string, int, error) {
@@ -188,19 +511,20 @@ func parseArgs(args []string) (string, int, error) {
 	// says that 9840 is the default port for Kafka Connect exporter, so we will
 	// use it as default here as well.
 	port := fs.Int("port", 9840, "Port to bind the metrics server to")
+	config := fs.String("config", "", "Path to the YAML config file declaring Kafka Connect clusters to scrape")
 
 	if err := fs.Parse(args); err != nil {
 		return "", 0, err
 	}
 
-	remaining := fs.Args()
-	if len(remaining) < 1 {
-		return "", 0, fmt.Errorf("missing required argument: connect-api")
+	if *config == "" {
+		return "", 0, fmt.Errorf("missing required flag: -config")
 	}
 
-	if len(remaining) > 1 {
-		return "", 0, fmt.Errorf("unexpected extra arguments: %v", remaining[1:])
+	remaining := fs.Args()
+	if len(remaining) > 0 {
+		return "", 0, fmt.Errorf("unexpected extra arguments: %v", remaining)
 	}
 
-	return remaining[0], *port, nil
+	return *config, *port, nil
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"resty.dev/v3"
+)
+
+const defaultProbeTimeout = 10 * time.Second
+
+// probeServer implements the blackbox_exporter-style /probe endpoint: build
+// an ephemeral collector for an arbitrary target, scrape it once into a
+// request-scoped registry, and render the result.
+//
+// The REST client (and its underlying http.Transport/connection pool) is
+// cached per target+module rather than rebuilt on every request, since
+// Prometheus reprobes the same targets on every scrape interval and a
+// fresh client per request would leak idle connections.
+type probeServer struct {
+	config *Config
+
+	mu      sync.Mutex
+	clients map[string]*resty.Client
+}
+
+func newProbeServer(config *Config) *probeServer {
+	return &probeServer{config: config, clients: make(map[string]*resty.Client)}
+}
+
+// clientFor returns the cached REST client for target+module, building and
+// caching one via newConnectClient on first use.
+func (p *probeServer) clientFor(cluster ClusterConfig, moduleName string) (*resty.Client, error) {
+	key := moduleName + "|" + cluster.APIURL
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if api, ok := p.clients[key]; ok {
+		return api, nil
+	}
+	api, err := newConnectClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = api
+	return api, nil
+}
+
+// handler implements GET /probe?target=...&module=....
+func (p *probeServer) handler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = "default"
+	}
+	module, ok := p.config.Modules[moduleName]
+	if !ok {
+		http.Error(w, "unknown module "+moduleName, http.StatusBadRequest)
+		return
+	}
+
+	timeout := probeTimeout(r)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	cluster := ClusterConfig{
+		Name:          target,
+		APIURL:        target,
+		ScrapeTimeout: Duration(timeout),
+		Auth: &AuthConfig{
+			BasicAuth:   module.BasicAuth,
+			BearerToken: module.BearerToken,
+		},
+	}
+
+	api, err := p.clientFor(cluster, moduleName)
+	if err != nil {
+		log.Printf("Error probing %s: %v", target, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	collector, err := newRestAPICollectorFromClient(ctx, cluster, api)
+	if err != nil {
+		log.Printf("Error probing %s: %v", target, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// probeTimeout derives the probe deadline from Prometheus's
+// X-Prometheus-Scrape-Timeout-Seconds header, falling back to a sane
+// default when the header is absent or unparsable.
+func probeTimeout(r *http.Request) time.Duration {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return defaultProbeTimeout
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return defaultProbeTimeout
+	}
+	return time.Duration(seconds * float64(time.Second))
+}